@@ -0,0 +1,145 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+)
+
+// defaultCleanupBatchSize is the number of expired rows deleted per
+// batch when WithCleanupBatchSize has not been set.
+const defaultCleanupBatchSize = 1000
+
+// defaultCleanupBatchSleep is the pause between batches within a
+// single cleanup pass when WithCleanupBatchSleep has not been set. It
+// gives other queries a chance at the table's lock between batches.
+const defaultCleanupBatchSleep = 100 * time.Millisecond
+
+// Stats describes the outcome of the most recently completed cleanup
+// pass, as reported by PgStore.Stats.
+type Stats struct {
+	RowsDeleted     int64
+	LastRunAt       time.Time
+	LastRunDuration time.Duration
+	LastErr         error
+}
+
+// WithCleanupBatchSize overrides the number of expired rows deleted
+// per batch during a cleanup pass. It defaults to
+// defaultCleanupBatchSize.
+func WithCleanupBatchSize(n int) Option {
+	return func(p *PgStore) {
+		p.cleanupBatchSize = n
+	}
+}
+
+// WithCleanupBatchSleep overrides the pause between batches within a
+// single cleanup pass. It defaults to defaultCleanupBatchSleep.
+func WithCleanupBatchSleep(d time.Duration) Option {
+	return func(p *PgStore) {
+		p.cleanupBatchSleep = d
+	}
+}
+
+// WithErrorHandler registers a callback invoked with the error
+// produced by a failed cleanup pass. It is called from the goroutine
+// running Run, so it must not block or call back into PgStore. If not
+// set, cleanup errors are only visible through Stats.
+func WithErrorHandler(h func(error)) Option {
+	return func(p *PgStore) {
+		p.errHandler = h
+	}
+}
+
+// Stats returns a snapshot of the most recently completed cleanup
+// pass. Its zero value means no pass has completed yet.
+func (p *PgStore) Stats() Stats {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+	return p.stats
+}
+
+// Run starts the cleanup loop, deleting expired sessions on the
+// interval configured by New, and blocks until ctx is cancelled. It
+// returns ctx.Err() once that happens. New starts Run in its own
+// goroutine when given a positive duration; call Run directly instead
+// when the caller needs to control the loop's shutdown with its own
+// context. If p.cleanupInterval is zero or negative (New's "cleanup
+// disabled" value), Run never schedules a pass and just blocks on ctx.
+func (p *PgStore) Run(ctx context.Context) error {
+	if p.cleanupInterval <= 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	t := time.NewTicker(p.cleanupInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			p.runCleanupPass(ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// runCleanupPass deletes all expired sessions in batches of
+// p.cleanupBatchSize, sleeping p.cleanupBatchSleep between batches,
+// until a batch deletes fewer than p.cleanupBatchSize rows, a batch
+// fails, or ctx is cancelled. It records the
+// outcome in p.stats and, if set, reports a failure to p.errHandler.
+func (p *PgStore) runCleanupPass(ctx context.Context) {
+	start := time.Now()
+
+	var total int64
+	var err error
+	for {
+		var n int
+		n, err = p.deleteExpiredBatch(ctx)
+		total += int64(n)
+		if err != nil || n < p.cleanupBatchSize {
+			break
+		}
+
+		select {
+		case <-time.After(p.cleanupBatchSleep):
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	p.statsMu.Lock()
+	p.stats = Stats{
+		RowsDeleted:     total,
+		LastRunAt:       start,
+		LastRunDuration: time.Since(start),
+		LastErr:         err,
+	}
+	p.statsMu.Unlock()
+
+	if err != nil && p.errHandler != nil {
+		p.errHandler(err)
+	}
+}
+
+// deleteExpiredBatch deletes at most p.cleanupBatchSize expired
+// sessions and returns how many rows were removed.
+func (p *PgStore) deleteExpiredBatch(ctx context.Context) (int, error) {
+	rows, err := p.stmt.deleteExpiredBatch.QueryContext(ctx, p.cleanupBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var n int
+	for rows.Next() {
+		n++
+	}
+
+	return n, rows.Err()
+}
@@ -0,0 +1,145 @@
+package pgstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDeleteExpiredBatch(t *testing.T) {
+	db, mock := mockDB(t)
+	defer db.Close()
+	tName := "sessions"
+	q := fmt.Sprintf(`DELETE FROM %s WHERE id IN (
+	SELECT id FROM %s WHERE expires_at < CURRENT_TIMESTAMP LIMIT $1
+) RETURNING id;`, tName, tName)
+	pg := PgStore{db: db, tName: tName, cleanupBatchSize: 2,
+		stmt: stmts{deleteExpiredBatch: prepareStmt(t, db, mock, q)}}
+
+	// 1
+	mock.ExpectQuery(q).WithArgs(2).WillReturnError(terr)
+	n, err := pg.deleteExpiredBatch(context.Background())
+	if err != terr {
+		t.Errorf("want %v, got %v", terr, err)
+	}
+
+	if n != 0 {
+		t.Errorf("want 0, got %d", n)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	// 2
+	rows := sqlmock.NewRows([]string{"id"}).AddRow("id1").AddRow("id2")
+	mock.ExpectQuery(q).WithArgs(2).WillReturnRows(rows)
+	n, err = pg.deleteExpiredBatch(context.Background())
+	if err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	if n != 2 {
+		t.Errorf("want 2, got %d", n)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
+
+func TestRunCleanupPass(t *testing.T) {
+	db, mock := mockDB(t)
+	defer db.Close()
+	tName := "sessions"
+	q := fmt.Sprintf(`DELETE FROM %s WHERE id IN (
+	SELECT id FROM %s WHERE expires_at < CURRENT_TIMESTAMP LIMIT $1
+) RETURNING id;`, tName, tName)
+	pg := PgStore{db: db, tName: tName, cleanupBatchSize: 2, cleanupBatchSleep: time.Millisecond,
+		stmt: stmts{deleteExpiredBatch: prepareStmt(t, db, mock, q)}}
+
+	var handled error
+	pg.errHandler = func(err error) { handled = err }
+
+	// first batch full, second batch short -> pass stops after two queries
+	full := sqlmock.NewRows([]string{"id"}).AddRow("id1").AddRow("id2")
+	mock.ExpectQuery(q).WithArgs(2).WillReturnRows(full)
+	short := sqlmock.NewRows([]string{"id"}).AddRow("id3")
+	mock.ExpectQuery(q).WithArgs(2).WillReturnRows(short)
+
+	pg.runCleanupPass(context.Background())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	stats := pg.Stats()
+	if stats.RowsDeleted != 3 {
+		t.Errorf("want 3, got %d", stats.RowsDeleted)
+	}
+
+	if stats.LastErr != nil {
+		t.Errorf("want nil, got %v", stats.LastErr)
+	}
+
+	if handled != nil {
+		t.Errorf("want nil, got %v", handled)
+	}
+}
+
+func TestRunCleanupPassErrHandler(t *testing.T) {
+	db, mock := mockDB(t)
+	defer db.Close()
+	tName := "sessions"
+	q := fmt.Sprintf(`DELETE FROM %s WHERE id IN (
+	SELECT id FROM %s WHERE expires_at < CURRENT_TIMESTAMP LIMIT $1
+) RETURNING id;`, tName, tName)
+	pg := PgStore{db: db, tName: tName, cleanupBatchSize: 2,
+		stmt: stmts{deleteExpiredBatch: prepareStmt(t, db, mock, q)}}
+
+	var handled error
+	pg.errHandler = func(err error) { handled = err }
+
+	mock.ExpectQuery(q).WithArgs(2).WillReturnError(terr)
+
+	pg.runCleanupPass(context.Background())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	if handled != terr {
+		t.Errorf("want %v, got %v", terr, handled)
+	}
+
+	if pg.Stats().LastErr != terr {
+		t.Errorf("want %v, got %v", terr, pg.Stats().LastErr)
+	}
+}
+
+func TestRun(t *testing.T) {
+	pg := PgStore{cleanupInterval: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	err := pg.Run(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestRunZeroInterval(t *testing.T) {
+	pg := PgStore{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	err := pg.Run(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,98 @@
+package pgstore
+
+import "fmt"
+
+// Dialect produces the SQL text QueryBuilder assembles into the
+// statements PgStore prepares at construction time. It exists so
+// that a store built against a Postgres-compatible engine with
+// different syntax needs (e.g. RETURNING support, schema-qualified
+// names) can supply its own SQL without PgStore's Go code changing.
+// PostgresDialect is the default and, for now, only implementation.
+type Dialect interface {
+	CreateTable(table string) string
+	Insert(table string) string
+	SelectByID(table string) string
+	SelectByUserKey(table string) string
+	DeleteByID(table string) string
+	DeleteByUserKey(table string) string
+	DeleteByUserKeyExcept(table string) string
+	DeleteExpiredBatch(table string) string
+	SelectByMeta(table string) string
+	SelectLiveIDs(table string) string
+}
+
+// PostgresDialect is the default Dialect, targeting stock PostgreSQL.
+type PostgresDialect struct{}
+
+// CreateTable returns the DDL used to create a fresh sessions table.
+func (PostgresDialect) CreateTable(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	id TEXT PRIMARY KEY,
+	user_key TEXT NOT NULL,
+	ip TEXT,
+	agent_os TEXT,
+	agent_browser TEXT,
+	meta_enc BYTEA,
+	meta JSONB NOT NULL DEFAULT '{}'::jsonb
+);`, table)
+}
+
+// Insert returns the statement used by Create.
+func (PostgresDialect) Insert(table string) string {
+	return fmt.Sprintf("INSERT INTO %s VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);", table)
+}
+
+// SelectByID returns the statement used by FetchByID.
+func (PostgresDialect) SelectByID(table string) string {
+	return fmt.Sprintf("SELECT * FROM %s WHERE id = $1 AND expires_at > CURRENT_TIMESTAMP;", table)
+}
+
+// SelectByUserKey returns the statement used by FetchByUserKey.
+func (PostgresDialect) SelectByUserKey(table string) string {
+	return fmt.Sprintf("SELECT * FROM %s WHERE user_key = $1;", table)
+}
+
+// DeleteByID returns the statement used by DeleteByID.
+func (PostgresDialect) DeleteByID(table string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE id = $1;", table)
+}
+
+// DeleteByUserKey returns the statement used by DeleteByUserKey when
+// called without exceptions.
+func (PostgresDialect) DeleteByUserKey(table string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE user_key = $1;", table)
+}
+
+// DeleteByUserKeyExcept returns the statement used by DeleteByUserKey
+// when called with one or more IDs to keep.
+func (PostgresDialect) DeleteByUserKeyExcept(table string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE user_key = $1 AND id != ALL ($2);", table)
+}
+
+// DeleteExpiredBatch returns the statement used by deleteExpiredBatch.
+// It deletes at most $1 expired rows and returns their ids, so the
+// cleanup loop can delete in small batches instead of taking one long
+// table lock and generating a single, possibly huge, WAL record.
+func (PostgresDialect) DeleteExpiredBatch(table string) string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE id IN (
+	SELECT id FROM %s WHERE expires_at < CURRENT_TIMESTAMP LIMIT $1
+) RETURNING id;`, table, table)
+}
+
+// SelectByMeta returns the statement used by FetchByMeta. It relies
+// on the JSONB containment operator (@>) and the GIN index Migrate
+// creates over the meta column, so a lookup like "all sessions for
+// tenant X" stays an index scan rather than a sequential one.
+func (PostgresDialect) SelectByMeta(table string) string {
+	return fmt.Sprintf("SELECT * FROM %s WHERE meta @> $1::jsonb;", table)
+}
+
+// SelectLiveIDs returns the statement used by reconcileLiveIDs to
+// snapshot every currently-live session ID after a LISTEN connection
+// reconnects, since Postgres doesn't persist NOTIFY payloads sent
+// during the outage.
+func (PostgresDialect) SelectLiveIDs(table string) string {
+	return fmt.Sprintf("SELECT id FROM %s WHERE expires_at > CURRENT_TIMESTAMP;", table)
+}
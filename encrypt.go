@@ -0,0 +1,93 @@
+package pgstore
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+
+	"github.com/swithek/sessionup"
+)
+
+// ErrDecryption is returned by Fetch methods when the ip, agent_os or
+// agent_browser fields cannot be decrypted, e.g. because the cipher
+// configured via WithCipher doesn't match the key the row was written
+// with. Callers can use it to detect rows that need a key rotation
+// pass instead of silently returning garbled session data.
+var ErrDecryption = errors.New("pgstore: failed to decrypt session metadata")
+
+// encMeta holds the fields that get encrypted as a single blob and
+// stored in the meta_enc column.
+type encMeta struct {
+	IP      string
+	OS      string
+	Browser string
+}
+
+// encryptMeta encrypts the ip, agent_os and agent_browser fields of s
+// and returns the per-row nonce and ciphertext packed together, ready
+// to be stored in the meta_enc column. It returns nil, nil when no
+// cipher has been configured, so callers fall back to the plaintext
+// columns.
+func (p *PgStore) encryptMeta(s sessionup.Session) ([]byte, error) {
+	if p.aead == nil {
+		return nil, nil
+	}
+
+	pt, err := json.Marshal(encMeta{
+		IP:      s.IP.String(),
+		OS:      s.Agent.OS,
+		Browser: s.Agent.Browser,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return p.aead.Seal(nonce, nonce, pt, nil), nil
+}
+
+// applyMeta fills in s.IP, s.Agent.OS and s.Agent.Browser, preferring
+// the encrypted metaEnc blob over the plaintext columns whenever a
+// cipher is configured and the blob is present. It returns
+// ErrDecryption if metaEnc can't be authenticated or parsed.
+func (p *PgStore) applyMeta(s *sessionup.Session, ip, os, browser sql.NullString, metaEnc []byte) error {
+	if p.aead == nil || len(metaEnc) == 0 {
+		if ip.Valid {
+			s.IP = net.ParseIP(ip.String)
+		}
+
+		s.Agent.OS = os.String
+		s.Agent.Browser = browser.String
+		return nil
+	}
+
+	ns := p.aead.NonceSize()
+	if len(metaEnc) < ns {
+		return ErrDecryption
+	}
+
+	nonce, ct := metaEnc[:ns], metaEnc[ns:]
+	pt, err := p.aead.Open(nil, nonce, ct, nil)
+	if err != nil {
+		return ErrDecryption
+	}
+
+	var m encMeta
+	if err := json.Unmarshal(pt, &m); err != nil {
+		return ErrDecryption
+	}
+
+	if m.IP != "" {
+		s.IP = net.ParseIP(m.IP)
+	}
+
+	s.Agent.OS = m.OS
+	s.Agent.Browser = m.Browser
+	return nil
+}
@@ -0,0 +1,78 @@
+package pgstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"database/sql"
+	"net"
+	"testing"
+
+	"github.com/swithek/sessionup"
+)
+
+func testAEAD(t *testing.T) cipher.AEAD {
+	block, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	return aead
+}
+
+func TestEncryptMetaDecryptMeta(t *testing.T) {
+	p := &PgStore{aead: testAEAD(t)}
+
+	s := sessionup.Session{IP: net.ParseIP("127.0.0.1")}
+	s.Agent.OS = "GNU/Linux"
+	s.Agent.Browser = "Firefox"
+
+	enc, err := p.encryptMeta(s)
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if len(enc) == 0 {
+		t.Fatal("want non-empty, got empty")
+	}
+
+	var out sessionup.Session
+	if err = p.applyMeta(&out, sql.NullString{}, sql.NullString{}, sql.NullString{}, enc); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if out.IP.String() != s.IP.String() {
+		t.Errorf("want %q, got %q", s.IP.String(), out.IP.String())
+	}
+
+	if out.Agent.OS != s.Agent.OS || out.Agent.Browser != s.Agent.Browser {
+		t.Errorf("want %v, got %v", s.Agent, out.Agent)
+	}
+}
+
+func TestEncryptMetaNoCipher(t *testing.T) {
+	p := &PgStore{}
+
+	enc, err := p.encryptMeta(sessionup.Session{})
+	if err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	if enc != nil {
+		t.Errorf("want nil, got %v", enc)
+	}
+}
+
+func TestApplyMetaDecryptionError(t *testing.T) {
+	p := &PgStore{aead: testAEAD(t)}
+
+	var out sessionup.Session
+	err := p.applyMeta(&out, sql.NullString{}, sql.NullString{}, sql.NullString{}, []byte("too short"))
+	if err != ErrDecryption {
+		t.Errorf("want %v, got %v", ErrDecryption, err)
+	}
+}
@@ -0,0 +1,78 @@
+package pgstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/swithek/sessionup"
+)
+
+// Marshaler produces the raw JSON stored in a session's meta column
+// on Create. It receives the ctx passed to Create, so callers can
+// stash arbitrary extension data (tenant ID, device fingerprint, MFA
+// level) onto ctx before calling Create and have it captured here,
+// without requiring sessionup.Session itself to grow new fields. A
+// nil result stores an empty JSON object.
+type Marshaler func(ctx context.Context) ([]byte, error)
+
+// Unmarshaler is handed the ctx passed to a fetch call alongside the
+// raw JSON a prior Marshaler wrote to the meta column, so callers can
+// recover their extension data (e.g. into a value stashed on ctx)
+// without PgStore exposing it on sessionup.Session.
+type Unmarshaler func(ctx context.Context, data []byte) error
+
+// WithMeta registers the Marshaler/Unmarshaler pair PgStore uses to
+// persist and recover caller-defined session metadata in the meta
+// JSONB column. Without it, every row's meta column is left as an
+// empty JSON object, and FetchByMeta only matches sessions stored by
+// a store that did have one configured.
+func WithMeta(m Marshaler, u Unmarshaler) Option {
+	return func(p *PgStore) {
+		p.metaMarshal = m
+		p.metaUnmarshal = u
+	}
+}
+
+// marshalMeta runs p.metaMarshal, if set, defaulting to an empty
+// JSON object so the meta column is never left NULL.
+func (p *PgStore) marshalMeta(ctx context.Context) ([]byte, error) {
+	if p.metaMarshal == nil {
+		return []byte("{}"), nil
+	}
+
+	data, err := p.metaMarshal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return []byte("{}"), nil
+	}
+
+	return data, nil
+}
+
+// unmarshalMeta runs p.metaUnmarshal, if set, against a row's raw
+// meta column.
+func (p *PgStore) unmarshalMeta(ctx context.Context, data []byte) error {
+	if p.metaUnmarshal == nil {
+		return nil
+	}
+
+	return p.metaUnmarshal(ctx, data)
+}
+
+// FetchByMeta returns every session whose meta column contains value
+// at the given top-level key, e.g. FetchByMeta(ctx, "tenant", "acme")
+// for "all sessions belonging to tenant acme". It relies on the GIN
+// index Migrate creates over the meta column and Postgres's JSONB
+// containment operator (@>), so the lookup stays an index scan
+// rather than a sequential one.
+func (p *PgStore) FetchByMeta(ctx context.Context, jsonPath string, value interface{}) ([]sessionup.Session, error) {
+	filter, err := json.Marshal(map[string]interface{}{jsonPath: value})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.fetchByUserKey(ctx, p.stmt.selectByMeta, string(filter))
+}
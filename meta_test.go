@@ -0,0 +1,108 @@
+package pgstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/swithek/sessionup"
+)
+
+func TestMarshalMeta(t *testing.T) {
+	p := &PgStore{}
+
+	data, err := p.marshalMeta(context.Background())
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if string(data) != "{}" {
+		t.Errorf("want %q, got %q", "{}", data)
+	}
+
+	p.metaMarshal = func(context.Context) ([]byte, error) {
+		return []byte(`{"tenant":"acme"}`), nil
+	}
+
+	data, err = p.marshalMeta(context.Background())
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if string(data) != `{"tenant":"acme"}` {
+		t.Errorf("want %q, got %q", `{"tenant":"acme"}`, data)
+	}
+
+	p.metaMarshal = func(context.Context) ([]byte, error) {
+		return nil, terr
+	}
+
+	if _, err = p.marshalMeta(context.Background()); err != terr {
+		t.Errorf("want %v, got %v", terr, err)
+	}
+}
+
+func TestUnmarshalMeta(t *testing.T) {
+	p := &PgStore{}
+
+	if err := p.unmarshalMeta(context.Background(), []byte("{}")); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	var got []byte
+	p.metaUnmarshal = func(_ context.Context, data []byte) error {
+		got = data
+		return nil
+	}
+
+	if err := p.unmarshalMeta(context.Background(), []byte(`{"tenant":"acme"}`)); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	if string(got) != `{"tenant":"acme"}` {
+		t.Errorf("want %q, got %q", `{"tenant":"acme"}`, got)
+	}
+
+	p.metaUnmarshal = func(context.Context, []byte) error {
+		return terr
+	}
+
+	if err := p.unmarshalMeta(context.Background(), []byte("{}")); err != terr {
+		t.Errorf("want %v, got %v", terr, err)
+	}
+}
+
+func TestFetchByMeta(t *testing.T) {
+	db, mock := mockDB(t)
+	defer db.Close()
+	tName := "sessions"
+	q := fmt.Sprintf("SELECT * FROM %s WHERE meta @> $1::jsonb;", tName)
+	pg := PgStore{db: db, tName: tName, stmt: stmts{selectByMeta: prepareStmt(t, db, mock, q)}}
+
+	s := sessionup.Session{
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now(),
+		ID:        "id",
+		UserKey:   "key",
+	}
+
+	rows := sqlmock.NewRows([]string{"created_at", "expires_at", "id",
+		"user_key", "ip", "agent_os", "agent_browser", "meta_enc", "meta"}).
+		AddRow(s.CreatedAt, s.ExpiresAt, s.ID, s.UserKey, nil, nil, nil, nil, []byte(`{"tenant":"acme"}`))
+	mock.ExpectQuery(q).WithArgs(`{"tenant":"acme"}`).WillReturnRows(rows)
+
+	ss, err := pg.FetchByMeta(context.Background(), "tenant", "acme")
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if len(ss) != 1 || ss[0].ID != s.ID {
+		t.Errorf("want %v, got %v", []sessionup.Session{s}, ss)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+)
+
+// schemaVersionTable tracks, per managed table name, which of the
+// migrations below have already been applied. It is shared by every
+// PgStore pointed at the same database, since several stores may
+// manage different session tables in it.
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS pgstore_schema_version (
+	table_name TEXT PRIMARY KEY,
+	version INTEGER NOT NULL
+);`
+
+// currentSchemaVersion is the schema version New/Migrate bring a
+// table up to. Bump it, and append an entry to migrations, whenever a
+// new in-place upgrade is introduced.
+const currentSchemaVersion = 3
+
+// migrations holds the DDL that upgrades a table from version i to
+// version i+1. It is applied in order starting from a table's
+// current recorded version (0 for a table with no schema_version
+// row, i.e. one that predates this migrator).
+var migrations = []string{
+	// 0 -> 1: encryption support added the meta_enc column; fresh
+	// tables already have it via CreateTable, but this ALTER is what
+	// upgrades a table created before that change, without touching
+	// existing rows.
+	0: `ALTER TABLE %s ADD COLUMN IF NOT EXISTS meta_enc BYTEA;`,
+
+	// 1 -> 2: large deployments were table-scanning on every
+	// FetchByUserKey call and cleanup tick.
+	1: `CREATE INDEX IF NOT EXISTS %[1]s_expires_at_idx ON %[1]s (expires_at);
+	CREATE INDEX IF NOT EXISTS %[1]s_user_key_idx ON %[1]s (user_key);`,
+
+	// 2 -> 3: extensible metadata added the meta column, plus a GIN
+	// index so FetchByMeta's containment lookups don't fall back to
+	// a sequential scan.
+	2: `ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS meta JSONB NOT NULL DEFAULT '{}'::jsonb;
+	CREATE INDEX IF NOT EXISTS %[1]s_meta_idx ON %[1]s USING GIN (meta jsonb_path_ops);`,
+}
+
+// Migrate brings the table managed by p up to currentSchemaVersion,
+// applying only the migrations a given deployment hasn't seen yet. It
+// is idempotent and safe to call from multiple PgStore instances at
+// once: it takes a Postgres advisory lock, scoped to the table name,
+// for the duration of the upgrade. New calls Migrate automatically;
+// this method is exposed separately for callers who want to run
+// migrations out-of-band (e.g. during a deploy step) rather than on
+// every process start.
+func (p *PgStore) Migrate(ctx context.Context) error {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Advisory locks are tied to the backend session that took them,
+	// so every step below must run on this single *sql.Conn rather
+	// than p.db - going back to the pool could hand us a different
+	// connection and silently drop the lock.
+	lockKey := advisoryLockKey(p.tName)
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", lockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1);", lockKey)
+
+	if _, err := conn.ExecContext(ctx, schemaVersionTable); err != nil {
+		return err
+	}
+
+	version, err := p.schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for ; version < currentSchemaVersion; version++ {
+		stmt := fmt.Sprintf(migrations[version], p.tName)
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return p.setSchemaVersion(ctx, conn, version)
+}
+
+// schemaVersion returns the schema version recorded for p.tName, or 0
+// if no row exists yet.
+func (p *PgStore) schemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var v int
+	q := "SELECT version FROM pgstore_schema_version WHERE table_name = $1;"
+	err := conn.QueryRowContext(ctx, q, p.tName).Scan(&v)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return v, err
+}
+
+// setSchemaVersion records v as the schema version for p.tName.
+func (p *PgStore) setSchemaVersion(ctx context.Context, conn *sql.Conn, v int) error {
+	q := `INSERT INTO pgstore_schema_version (table_name, version) VALUES ($1, $2)
+		ON CONFLICT (table_name) DO UPDATE SET version = EXCLUDED.version;`
+	_, err := conn.ExecContext(ctx, q, p.tName, v)
+	return err
+}
+
+// advisoryLockKey derives a stable int64 key for Postgres advisory
+// locks from a table name, so concurrent migrations of different
+// tables don't contend with one another.
+func advisoryLockKey(tName string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("pgstore:" + tName))
+	return int64(h.Sum64())
+}
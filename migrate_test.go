@@ -0,0 +1,97 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMigrate(t *testing.T) {
+	db, mock := mockDB(t)
+	defer db.Close()
+
+	tName := "sessions"
+	p := &PgStore{db: db, tName: tName}
+	lockKey := advisoryLockKey(tName)
+
+	mock.ExpectExec("SELECT pg_advisory_lock($1);").WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(schemaVersionTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version FROM pgstore_schema_version WHERE table_name = $1;").
+		WithArgs(tName).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectExec(fmt.Sprintf(migrations[1], tName)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(fmt.Sprintf(migrations[2], tName)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO pgstore_schema_version (table_name, version) VALUES ($1, $2)\n\t\tON CONFLICT (table_name) DO UPDATE SET version = EXCLUDED.version;").
+		WithArgs(tName, currentSchemaVersion).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SELECT pg_advisory_unlock($1);").WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := p.Migrate(context.Background()); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
+
+func TestMigrateLockError(t *testing.T) {
+	db, mock := mockDB(t)
+	defer db.Close()
+
+	tName := "sessions"
+	p := &PgStore{db: db, tName: tName}
+
+	mock.ExpectExec("SELECT pg_advisory_lock($1);").
+		WithArgs(advisoryLockKey(tName)).WillReturnError(terr)
+
+	err := p.Migrate(context.Background())
+	if err != terr {
+		t.Errorf("want %v, got %v", terr, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
+
+func TestSchemaVersionNoRow(t *testing.T) {
+	db, mock := mockDB(t)
+	defer db.Close()
+
+	tName := "sessions"
+	p := &PgStore{db: db, tName: tName}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	defer conn.Close()
+
+	mock.ExpectQuery("SELECT version FROM pgstore_schema_version WHERE table_name = $1;").
+		WithArgs(tName).WillReturnError(sql.ErrNoRows)
+
+	v, err := p.schemaVersion(context.Background(), conn)
+	if err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	if v != 0 {
+		t.Errorf("want 0, got %d", v)
+	}
+}
+
+func TestAdvisoryLockKeyStable(t *testing.T) {
+	a := advisoryLockKey("sessions")
+	b := advisoryLockKey("sessions")
+	c := advisoryLockKey("other")
+
+	if a != b {
+		t.Errorf("want equal keys, got %d and %d", a, b)
+	}
+
+	if a == c {
+		t.Errorf("want different keys, got %d for both", a)
+	}
+}
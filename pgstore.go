@@ -2,58 +2,141 @@ package pgstore
 
 import (
 	"context"
+	"crypto/cipher"
 	"database/sql"
 	"fmt"
-	"net"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/lib/pq"
 	"github.com/swithek/sessionup"
 )
 
-const table = `CREATE TABLE IF NOT EXISTS %s (
-	created_at TIMESTAMPTZ NOT NULL,
-	expires_at TIMESTAMPTZ NOT NULL,
-	id TEXT PRIMARY KEY,
-	user_key TEXT NOT NULL,
-	ip TEXT,
-	agent_os TEXT,
-	agent_browser TEXT
-);`
-
 // PgStore is a PostgreSQL implementation of sessionup.Store.
 type PgStore struct {
-	db       *sql.DB
-	tName    string
-	stopChan chan struct{}
-	errChan  chan error
+	db         *sql.DB
+	tName      string
+	aead       cipher.AEAD
+	revokeChan string
+	revokeDSN  string
+	readTxOpts *sql.TxOptions
+	dialect    Dialect
+	stmt       stmts
+
+	metaMarshal   Marshaler
+	metaUnmarshal Unmarshaler
+
+	cleanupInterval   time.Duration
+	cleanupBatchSize  int
+	cleanupBatchSleep time.Duration
+	errHandler        func(error)
+	cancelCleanup     context.CancelFunc
+
+	statsMu sync.Mutex
+	stats   Stats
+}
+
+// Option is used to configure optional PgStore behaviour on
+// construction.
+type Option func(*PgStore)
+
+// WithCipher enables transparent encryption of the ip, agent_os and
+// agent_browser fields using the given AEAD cipher (e.g. one built
+// from crypto/aes with GCM). The ciphertext and its per-row nonce are
+// stored together in the meta_enc column instead of the plaintext
+// columns, so that managed Postgres deployments don't leak PII to
+// anyone with DB or pg_dump access. Existing unencrypted rows remain
+// readable; only rows written after the cipher is set are encrypted.
+func WithCipher(aead cipher.AEAD) Option {
+	return func(p *PgStore) {
+		p.aead = aead
+	}
+}
+
+// WithDialect overrides the Dialect used to render the SQL PgStore
+// prepares at construction time. It defaults to PostgresDialect.
+func WithDialect(d Dialect) Option {
+	return func(p *PgStore) {
+		p.dialect = d
+	}
 }
 
 // New returns a fresh instance of PgStore.
 // tName parameter determines the name of the table that
 // will be used for sessions. If it does not exist, it will
 // be created.
-// Duration parameter determines how often the cleanup
-// function wil be called to remove the expired sessions.
-// Setting it to 0 will prevent cleanup from being activated.
-func New(db *sql.DB, tName string, d time.Duration) (*PgStore, error) {
-	p := &PgStore{db: db, tName: tName, errChan: make(chan error)}
-	_, err := p.db.Exec(fmt.Sprintf(table, p.tName))
-	if err != nil {
+// Duration parameter determines how often the cleanup loop removes
+// expired sessions. Setting it to 0 will prevent cleanup from being
+// activated. When greater than 0, New starts the cleanup loop itself,
+// equivalent to calling Run with a context that's cancelled by Close;
+// call Run directly instead if the caller needs its own context to
+// control shutdown.
+func New(db *sql.DB, tName string, d time.Duration, oo ...Option) (*PgStore, error) {
+	p := &PgStore{
+		db:                db,
+		tName:             tName,
+		dialect:           PostgresDialect{},
+		cleanupInterval:   d,
+		cleanupBatchSize:  defaultCleanupBatchSize,
+		cleanupBatchSleep: defaultCleanupBatchSleep,
+	}
+	for _, o := range oo {
+		o(p)
+	}
+
+	ctx := context.Background()
+
+	if _, err := p.db.ExecContext(ctx, p.dialect.CreateTable(p.tName)); err != nil {
+		return nil, err
+	}
+
+	if err := p.Migrate(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := p.prepare(ctx); err != nil {
 		return nil, err
 	}
 
 	if d > 0 {
-		go p.startCleanup(d)
+		runCtx, cancel := context.WithCancel(context.Background())
+		p.cancelCleanup = cancel
+		go p.Run(runCtx)
 	}
+
 	return p, nil
 }
 
 // Create implements sessionup.Store interface's Create method.
 func (p *PgStore) Create(ctx context.Context, s sessionup.Session) error {
-	q := fmt.Sprintf("INSERT INTO %s VALUES ($1, $2, $3, $4, $5, $6, $7);", p.tName)
-	_, err := p.db.ExecContext(ctx, q, s.CreatedAt, s.ExpiresAt, s.ID, s.UserKey,
-		setNullString(s.IP.String()), setNullString(s.Agent.OS), setNullString(s.Agent.Browser))
+	ip, os, browser := setNullString(s.IP.String()), setNullString(s.Agent.OS), setNullString(s.Agent.Browser)
+
+	metaEnc, err := p.encryptMeta(s)
+	if err != nil {
+		return err
+	}
+
+	if metaEnc != nil {
+		ip, os, browser = sql.NullString{}, sql.NullString{}, sql.NullString{}
+	}
+
+	meta, err := p.marshalMeta(ctx)
+	if err != nil {
+		return err
+	}
+
+	// metaEnc is a typed []byte; passed as-is through the variadic
+	// ...interface{} below, a nil value still boxes as a non-nil
+	// interface{ []byte, nil }, so the driver stores an empty value
+	// instead of SQL NULL. Boxing an untyped nil instead is what
+	// actually gets the column stored NULL.
+	var encArg interface{}
+	if metaEnc != nil {
+		encArg = metaEnc
+	}
+
+	_, err = p.stmt.insert.ExecContext(ctx, s.CreatedAt, s.ExpiresAt, s.ID, s.UserKey, ip, os, browser, encArg, meta)
 	if perr, ok := err.(*pq.Error); ok && perr.Constraint == fmt.Sprintf("%s_pkey", p.tName) {
 		return sessionup.ErrDuplicateID
 	}
@@ -61,33 +144,76 @@ func (p *PgStore) Create(ctx context.Context, s sessionup.Session) error {
 }
 
 // FetchByID implements sessionup.Store interface's FetchByID method.
+// If WithReadTxOptions was set on New, the fetch runs inside a
+// snapshot transaction instead of the default fast path; see
+// WithReadTxOptions for details.
 func (p *PgStore) FetchByID(ctx context.Context, id string) (sessionup.Session, bool, error) {
-	q := fmt.Sprintf("SELECT * FROM %s WHERE id = $1 AND expires_at > CURRENT_TIMESTAMP;", p.tName)
-	r := p.db.QueryRowContext(ctx, q, id)
+	if p.readTxOpts == nil {
+		return p.fetchByID(ctx, p.stmt.selectByID, id)
+	}
+
+	tx, err := p.db.BeginTx(ctx, p.readTxOpts)
+	if err != nil {
+		return sessionup.Session{}, false, err
+	}
+
+	s, ok, err := p.fetchByID(ctx, tx.StmtContext(ctx, p.stmt.selectByID), id)
+	if cerr := p.finishReadTx(tx, err); cerr != nil {
+		return sessionup.Session{}, false, cerr
+	}
+
+	return s, ok, nil
+}
+
+func (p *PgStore) fetchByID(ctx context.Context, st stmtQuerier, id string) (sessionup.Session, bool, error) {
+	r := st.QueryRowContext(ctx, id)
 
 	var s sessionup.Session
 	var ip, os, browser sql.NullString
+	var metaEnc, meta []byte
 
-	err := r.Scan(&s.CreatedAt, &s.ExpiresAt, &s.ID, &s.UserKey, &ip, &os, &browser)
+	err := r.Scan(&s.CreatedAt, &s.ExpiresAt, &s.ID, &s.UserKey, &ip, &os, &browser, &metaEnc, &meta)
 	if err == sql.ErrNoRows {
 		return sessionup.Session{}, false, nil
 	} else if err != nil {
 		return sessionup.Session{}, false, err
 	}
 
-	if ip.Valid {
-		s.IP = net.ParseIP(ip.String)
+	if err := p.applyMeta(&s, ip, os, browser, metaEnc); err != nil {
+		return sessionup.Session{}, false, err
+	}
+
+	if err := p.unmarshalMeta(ctx, meta); err != nil {
+		return sessionup.Session{}, false, err
 	}
 
-	s.Agent.OS = os.String
-	s.Agent.Browser = browser.String
 	return s, true, nil
 }
 
 // FetchByUserKey implements sessionup.Store interface's FetchByUserKey method.
+// If WithReadTxOptions was set on New, the fetch runs inside a
+// snapshot transaction instead of the default fast path; see
+// WithReadTxOptions for details.
 func (p *PgStore) FetchByUserKey(ctx context.Context, key string) ([]sessionup.Session, error) {
-	q := fmt.Sprintf("SELECT * FROM %s WHERE user_key = $1;", p.tName)
-	rr, err := p.db.QueryContext(ctx, q, key)
+	if p.readTxOpts == nil {
+		return p.fetchByUserKey(ctx, p.stmt.selectByUserKey, key)
+	}
+
+	tx, err := p.db.BeginTx(ctx, p.readTxOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	ss, err := p.fetchByUserKey(ctx, tx.StmtContext(ctx, p.stmt.selectByUserKey), key)
+	if cerr := p.finishReadTx(tx, err); cerr != nil {
+		return nil, cerr
+	}
+
+	return ss, nil
+}
+
+func (p *PgStore) fetchByUserKey(ctx context.Context, st stmtQuerier, key string) ([]sessionup.Session, error) {
+	rr, err := st.QueryContext(ctx, key)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -98,19 +224,23 @@ func (p *PgStore) FetchByUserKey(ctx context.Context, key string) ([]sessionup.S
 	for rr.Next() {
 		var s sessionup.Session
 		var ip, os, browser sql.NullString
+		var metaEnc, meta []byte
 
-		err = rr.Scan(&s.CreatedAt, &s.ExpiresAt, &s.ID, &s.UserKey, &ip, &os, &browser)
+		err = rr.Scan(&s.CreatedAt, &s.ExpiresAt, &s.ID, &s.UserKey, &ip, &os, &browser, &metaEnc, &meta)
 		if err != nil {
 			rr.Close()
 			return nil, err
 		}
 
-		if ip.Valid {
-			s.IP = net.ParseIP(ip.String)
+		if err := p.applyMeta(&s, ip, os, browser, metaEnc); err != nil {
+			rr.Close()
+			return nil, err
 		}
 
-		s.Agent.OS = os.String
-		s.Agent.Browser = browser.String
+		if err := p.unmarshalMeta(ctx, meta); err != nil {
+			rr.Close()
+			return nil, err
+		}
 
 		ss = append(ss, s)
 	}
@@ -124,64 +254,32 @@ func (p *PgStore) FetchByUserKey(ctx context.Context, key string) ([]sessionup.S
 
 // DeleteByID implements sessionup.Store interface's DeleteByID method.
 func (p *PgStore) DeleteByID(ctx context.Context, id string) error {
-	q := fmt.Sprintf("DELETE FROM %s WHERE id = $1;", p.tName)
-	_, err := p.db.ExecContext(ctx, q, id)
-	return err
-}
-
-// DeleteByUserKey implements sessionup.Store interface's DeleteByUserKey method.
-func (p *PgStore) DeleteByUserKey(ctx context.Context, key string, expID ...string) error {
-	if len(expID) > 0 {
-		q := fmt.Sprintf("DELETE FROM %s WHERE user_key = $1 AND id != ALL ($2);", p.tName)
-		_, err := p.db.ExecContext(ctx, q, append([]interface{}{key}, pq.Array(expID))...)
+	if _, err := p.stmt.deleteByID.ExecContext(ctx, id); err != nil {
 		return err
 	}
 
-	q := fmt.Sprintf("DELETE FROM %s WHERE user_key = $1;", p.tName)
-	_, err := p.db.ExecContext(ctx, q, key)
-	return err
-}
-
-// deleteExpired deletes all expired sessions.
-func (p *PgStore) deleteExpired() error {
-	q := fmt.Sprintf("DELETE FROM %s WHERE expires_at < CURRENT_TIMESTAMP;", p.tName)
-	_, err := p.db.Exec(q)
-	return err
+	return p.notifyRevoke(ctx, "id:"+id)
 }
 
-// startCleanup activates repeated sessions' checking and
-// deletion process.
-func (p *PgStore) startCleanup(d time.Duration) {
-	p.stopChan = make(chan struct{})
-	t := time.NewTicker(d)
-	for {
-		select {
-		case <-t.C:
-			if err := p.deleteExpired(); err != nil {
-				p.errChan <- err
-			}
-		case <-p.stopChan:
-			t.Stop()
-			return
+// DeleteByUserKey implements sessionup.Store interface's DeleteByUserKey method.
+func (p *PgStore) DeleteByUserKey(ctx context.Context, key string, expID ...string) error {
+	if len(expID) > 0 {
+		if _, err := p.stmt.deleteByUserKeyExcept.ExecContext(ctx, key, pq.Array(expID)); err != nil {
+			return err
 		}
+
+		// The expID sessions were deliberately kept alive, so this
+		// must not be broadcast as the unqualified "key:" payload -
+		// that would tell subscribers every session of key was
+		// revoked, including the ones just excepted.
+		return p.notifyRevoke(ctx, "keyexcept:"+strings.Join(expID, ",")+":"+key)
 	}
-}
 
-// StopCleanup terminates the automatic cleanup process.
-// Useful for testing and cases when store is used only temporary.
-// In order to restart the cleanup, new store must be created.
-func (p *PgStore) StopCleanup() {
-	if p.stopChan != nil {
-		p.stopChan <- struct{}{}
+	if _, err := p.stmt.deleteByUserKey.ExecContext(ctx, key); err != nil {
+		return err
 	}
-}
 
-// CleanupErr returns a receive-only channel to get errors
-// produced during the automatic cleanup.
-// NOTE: channel must be drained in order for the cleanup
-// process to be able to continue.
-func (p *PgStore) CleanupErr() <-chan error {
-	return p.errChan
+	return p.notifyRevoke(ctx, "key:"+key)
 }
 
 // setNullString creates sql.NullString from the input string.
@@ -40,9 +40,9 @@ func TestNew(t *testing.T) {
 		}
 	}
 
-	hasStore := func(tN string, db, errChan, stopChan bool) check {
+	hasStore := func(tN string, db, cleanup bool) check {
 		return func(t *testing.T, pg *PgStore, _ error) {
-			if tN == "" && !db && !errChan && !stopChan {
+			if tN == "" && !db && !cleanup {
 				return
 			}
 
@@ -58,22 +58,49 @@ func TestNew(t *testing.T) {
 				t.Errorf("want %q, got %q", tN, pg.tName)
 			}
 
-			if errChan && pg.errChan == nil {
+			if cleanup && pg.cancelCleanup == nil {
 				t.Error("want non-nil, got nil")
 			}
 
-			if stopChan && pg.stopChan != nil {
+			if !cleanup && pg.cancelCleanup != nil {
 				t.Error("want nil, got non-nil")
 			}
 
-			pg.StopCleanup()
+			pg.Close()
 		}
 	}
 
 	db, mock := mockDB(t)
 	defer db.Close()
 	tName := "sessions"
-	q := fmt.Sprintf(table, tName)
+
+	expectMigration := func() {
+		mock.ExpectExec("SELECT pg_advisory_lock($1);").
+			WithArgs(advisoryLockKey(tName)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(schemaVersionTable).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT version FROM pgstore_schema_version WHERE table_name = $1;").
+			WithArgs(tName).WillReturnError(sql.ErrNoRows)
+
+		for v := 0; v < currentSchemaVersion; v++ {
+			mock.ExpectExec(fmt.Sprintf(migrations[v], tName)).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+
+		mock.ExpectExec("INSERT INTO pgstore_schema_version (table_name, version) VALUES ($1, $2)\n\t\tON CONFLICT (table_name) DO UPDATE SET version = EXCLUDED.version;").
+			WithArgs(tName, currentSchemaVersion).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("SELECT pg_advisory_unlock($1);").
+			WithArgs(advisoryLockKey(tName)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	expectPrepare := func() {
+		b := NewQueryBuilder(PostgresDialect{}, tName)
+		for _, q := range []string{
+			b.insert(), b.selectByID(), b.selectByUserKey(), b.deleteByID(),
+			b.deleteByUserKey(), b.deleteByUserKeyExcept(), b.deleteExpiredBatch(),
+			b.selectByMeta(), b.selectLiveIDs(),
+		} {
+			mock.ExpectPrepare(q)
+		}
+	}
 
 	cc := map[string]struct {
 		Expect   func()
@@ -82,31 +109,46 @@ func TestNew(t *testing.T) {
 	}{
 		"Error returned during table creation": {
 			Expect: func() {
-				mock.ExpectExec(q).WillReturnError(terr)
+				mock.ExpectExec(PostgresDialect{}.CreateTable(tName)).WillReturnError(terr)
 			},
 			Duration: time.Hour,
 			Checks: checks(
 				hasErr(terr),
-				hasStore("", false, false, false),
+				hasStore("", false, false),
+			),
+		},
+		"Error returned during migration": {
+			Expect: func() {
+				mock.ExpectExec(PostgresDialect{}.CreateTable(tName)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("SELECT pg_advisory_lock($1);").
+					WithArgs(advisoryLockKey(tName)).WillReturnError(terr)
+			},
+			Checks: checks(
+				hasErr(terr),
+				hasStore("", false, false),
 			),
 		},
 		"Successful init without cleanup": {
 			Expect: func() {
-				mock.ExpectExec(q).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(PostgresDialect{}.CreateTable(tName)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectMigration()
+				expectPrepare()
 			},
 			Checks: checks(
 				hasErr(nil),
-				hasStore(tName, true, true, false),
+				hasStore(tName, true, false),
 			),
 		},
 		"Successful init with cleanup": {
 			Expect: func() {
-				mock.ExpectExec(q).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(PostgresDialect{}.CreateTable(tName)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectMigration()
+				expectPrepare()
 			},
 			Duration: time.Hour,
 			Checks: checks(
 				hasErr(nil),
-				hasStore(tName, true, true, true),
+				hasStore(tName, true, true),
 			),
 		},
 	}
@@ -130,8 +172,8 @@ func TestCreate(t *testing.T) {
 	db, mock := mockDB(t)
 	defer db.Close()
 	tName := "sessions"
-	pg := PgStore{db: db, tName: tName}
-	q := fmt.Sprintf("INSERT INTO %s VALUES ($1, $2, $3, $4, $5, $6, $7);", tName)
+	q := fmt.Sprintf("INSERT INTO %s VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);", tName)
+	pg := PgStore{db: db, tName: tName, stmt: stmts{insert: prepareStmt(t, db, mock, q)}}
 
 	s := sessionup.Session{
 		CreatedAt: time.Now(),
@@ -151,7 +193,7 @@ func TestCreate(t *testing.T) {
 			Expect: func() {
 				mock.ExpectExec(q).
 					WithArgs(s.CreatedAt, s.ExpiresAt, s.ID, s.UserKey,
-						s.IP.String(), s.Agent.OS, s.Agent.Browser).
+						s.IP.String(), s.Agent.OS, s.Agent.Browser, nil, []byte("{}")).
 					WillReturnError(&pq.Error{Constraint: fmt.Sprintf("%s_pkey", tName)})
 			},
 			Err: sessionup.ErrDuplicateID,
@@ -160,7 +202,7 @@ func TestCreate(t *testing.T) {
 			Expect: func() {
 				mock.ExpectExec(q).
 					WithArgs(s.CreatedAt, s.ExpiresAt, s.ID, s.UserKey,
-						s.IP.String(), s.Agent.OS, s.Agent.Browser).
+						s.IP.String(), s.Agent.OS, s.Agent.Browser, nil, []byte("{}")).
 					WillReturnError(terr)
 			},
 			Err: terr,
@@ -169,7 +211,7 @@ func TestCreate(t *testing.T) {
 			Expect: func() {
 				mock.ExpectExec(q).
 					WithArgs(s.CreatedAt, s.ExpiresAt, s.ID, s.UserKey,
-						s.IP.String(), s.Agent.OS, s.Agent.Browser).
+						s.IP.String(), s.Agent.OS, s.Agent.Browser, nil, []byte("{}")).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 		},
@@ -219,8 +261,8 @@ func TestFetchByID(t *testing.T) {
 	db, mock := mockDB(t)
 	defer db.Close()
 	tName := "sessions"
-	pg := PgStore{db: db, tName: tName}
 	q := fmt.Sprintf("SELECT * FROM %s WHERE id = $1 AND expires_at > CURRENT_TIMESTAMP;", tName)
+	pg := PgStore{db: db, tName: tName, stmt: stmts{selectByID: prepareStmt(t, db, mock, q)}}
 
 	s := sessionup.Session{
 		CreatedAt: time.Now(),
@@ -257,9 +299,9 @@ func TestFetchByID(t *testing.T) {
 		"Successful select": {
 			Expect: func() {
 				rows := sqlmock.NewRows([]string{"created_at", "expires_at", "id",
-					"user_key", "ip", "agent_os", "agent_browser"}).
+					"user_key", "ip", "agent_os", "agent_browser", "meta_enc", "meta"}).
 					AddRow(s.CreatedAt, s.ExpiresAt, s.ID, s.UserKey,
-						s.IP.String(), s.Agent.OS, s.Agent.Browser)
+						s.IP.String(), s.Agent.OS, s.Agent.Browser, nil, []byte("{}"))
 				mock.ExpectQuery(q).WithArgs(s.ID).WillReturnRows(rows)
 			},
 			Checks: checks(
@@ -309,8 +351,8 @@ func TestFetchByUserKey(t *testing.T) {
 	defer db.Close()
 	key := "key"
 	tName := "sessions"
-	pg := PgStore{db: db, tName: tName}
 	q := fmt.Sprintf("SELECT * FROM %s WHERE user_key = $1;", tName)
+	pg := PgStore{db: db, tName: tName, stmt: stmts{selectByUserKey: prepareStmt(t, db, mock, q)}}
 
 	gen := func() []sessionup.Session {
 		var res []sessionup.Session
@@ -345,10 +387,10 @@ func TestFetchByUserKey(t *testing.T) {
 		"Successful select": {
 			Expect: func() {
 				rows := sqlmock.NewRows([]string{"created_at", "expires_at", "id",
-					"user_key", "ip", "agent_os", "agent_browser"})
+					"user_key", "ip", "agent_os", "agent_browser", "meta_enc", "meta"})
 				for _, s := range gen() {
 					rows.AddRow(s.CreatedAt, s.ExpiresAt, s.ID, s.UserKey, s.IP,
-						s.Agent.OS, s.Agent.Browser)
+						s.Agent.OS, s.Agent.Browser, nil, []byte("{}"))
 				}
 				mock.ExpectQuery(q).WithArgs(key).WillReturnRows(rows)
 			},
@@ -379,8 +421,8 @@ func TestDeleteByID(t *testing.T) {
 	defer db.Close()
 	id := "id"
 	tName := "sessions"
-	pg := PgStore{db: db, tName: tName}
 	q := fmt.Sprintf("DELETE FROM %s WHERE id = $1;", tName)
+	pg := PgStore{db: db, tName: tName, stmt: stmts{deleteByID: prepareStmt(t, db, mock, q)}}
 
 	// 1
 	mock.ExpectExec(q).WithArgs(id).WillReturnError(terr)
@@ -411,7 +453,12 @@ func TestDeleteByUserKey(t *testing.T) {
 	tName := "sessions"
 	key := "key"
 	ids := []string{"id1", "id2", "id3"}
-	pg := PgStore{db: db, tName: tName}
+	qNoExc := fmt.Sprintf("DELETE FROM %s WHERE user_key = $1;", tName)
+	qExc := fmt.Sprintf("DELETE FROM %s WHERE user_key = $1 AND id != ALL ($2);", tName)
+	pg := PgStore{db: db, tName: tName, stmt: stmts{
+		deleteByUserKey:       prepareStmt(t, db, mock, qNoExc),
+		deleteByUserKeyExcept: prepareStmt(t, db, mock, qExc),
+	}}
 
 	cc := map[string]struct {
 		Expect func()
@@ -420,16 +467,14 @@ func TestDeleteByUserKey(t *testing.T) {
 	}{
 		"Error returned during delete": {
 			Expect: func() {
-				q := fmt.Sprintf("DELETE FROM %s WHERE user_key = $1;", tName)
-				mock.ExpectExec(q).
+				mock.ExpectExec(qNoExc).
 					WithArgs(key).WillReturnError(terr)
 			},
 			Err: terr,
 		},
 		"Error returned during delete with exceptions": {
 			Expect: func() {
-				q := fmt.Sprintf("DELETE FROM %s WHERE user_key = $1 AND id != ALL ($2);", tName)
-				mock.ExpectExec(q).
+				mock.ExpectExec(qExc).
 					WithArgs(append([]driver.Value{key}, pq.Array(ids))...).
 					WillReturnError(terr)
 			},
@@ -438,16 +483,14 @@ func TestDeleteByUserKey(t *testing.T) {
 		},
 		"Successful delete": {
 			Expect: func() {
-				q := fmt.Sprintf("DELETE FROM %s WHERE user_key = $1;", tName)
-				mock.ExpectExec(q).
+				mock.ExpectExec(qNoExc).
 					WithArgs(key).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 		},
 		"Successful delete with exceptions": {
 			Expect: func() {
-				q := fmt.Sprintf("DELETE FROM %s WHERE user_key = $1 AND id != ALL ($2);", tName)
-				mock.ExpectExec(q).
+				mock.ExpectExec(qExc).
 					WithArgs(append([]driver.Value{key}, pq.Array(ids))...).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
@@ -470,36 +513,6 @@ func TestDeleteByUserKey(t *testing.T) {
 	}
 }
 
-func TestDeleteExpired(t *testing.T) {
-	db, mock := mockDB(t)
-	defer db.Close()
-	tName := "sessions"
-	pg := PgStore{db: db, tName: tName}
-	q := fmt.Sprintf("DELETE FROM %s WHERE expires_at < CURRENT_TIMESTAMP;", tName)
-
-	// 1
-	mock.ExpectExec(q).WillReturnError(terr)
-	err := pg.deleteExpired()
-	if err != terr {
-		t.Errorf("want %v, got %v", terr, err)
-	}
-
-	if err = mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("want nil, got %v", err)
-	}
-
-	// 2
-	mock.ExpectExec(q).WillReturnResult(sqlmock.NewResult(0, 1))
-	err = pg.deleteExpired()
-	if err != nil {
-		t.Errorf("want nil, got %v", err)
-	}
-
-	if err = mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("want nil, got %v", err)
-	}
-}
-
 func TestSetNullString(t *testing.T) {
 	s := setNullString("")
 	if s.Valid {
@@ -520,6 +533,18 @@ func TestSetNullString(t *testing.T) {
 	}
 }
 
+// prepareStmt primes mock to expect q being prepared and returns the
+// resulting *sql.Stmt, for wiring directly into a PgStore's stmt
+// field in tests that bypass New.
+func prepareStmt(t *testing.T, db *sql.DB, mock sqlmock.Sqlmock, q string) *sql.Stmt {
+	mock.ExpectPrepare(q)
+	stmt, err := db.PrepareContext(context.Background(), q)
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	return stmt
+}
+
 func mockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
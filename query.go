@@ -0,0 +1,129 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+)
+
+// QueryBuilder turns a Dialect's SQL templates into the statement
+// text for a specific table name.
+type QueryBuilder struct {
+	dialect Dialect
+	table   string
+}
+
+// NewQueryBuilder returns a QueryBuilder that renders d's templates
+// for the given table name.
+func NewQueryBuilder(d Dialect, table string) QueryBuilder {
+	return QueryBuilder{dialect: d, table: table}
+}
+
+func (b QueryBuilder) insert() string          { return b.dialect.Insert(b.table) }
+func (b QueryBuilder) selectByID() string      { return b.dialect.SelectByID(b.table) }
+func (b QueryBuilder) selectByUserKey() string { return b.dialect.SelectByUserKey(b.table) }
+func (b QueryBuilder) deleteByID() string      { return b.dialect.DeleteByID(b.table) }
+func (b QueryBuilder) deleteByUserKey() string { return b.dialect.DeleteByUserKey(b.table) }
+func (b QueryBuilder) deleteByUserKeyExcept() string {
+	return b.dialect.DeleteByUserKeyExcept(b.table)
+}
+func (b QueryBuilder) deleteExpiredBatch() string { return b.dialect.DeleteExpiredBatch(b.table) }
+func (b QueryBuilder) selectByMeta() string       { return b.dialect.SelectByMeta(b.table) }
+func (b QueryBuilder) selectLiveIDs() string      { return b.dialect.SelectLiveIDs(b.table) }
+
+// stmts holds one prepared statement per PgStore operation, cached
+// for the lifetime of a store instead of formatting and parsing SQL
+// on every call.
+type stmts struct {
+	insert                *sql.Stmt
+	selectByID            *sql.Stmt
+	selectByUserKey       *sql.Stmt
+	deleteByID            *sql.Stmt
+	deleteByUserKey       *sql.Stmt
+	deleteByUserKeyExcept *sql.Stmt
+	deleteExpiredBatch    *sql.Stmt
+	selectByMeta          *sql.Stmt
+	selectLiveIDs         *sql.Stmt
+}
+
+// prepare builds the statements of a QueryBuilder for p.dialect and
+// p.tName and prepares each of them against p.db, storing the result
+// in p.stmt. It must be called after the table has been created and
+// migrated, since preparing a statement against a column that doesn't
+// exist yet fails.
+func (p *PgStore) prepare(ctx context.Context) error {
+	b := NewQueryBuilder(p.dialect, p.tName)
+
+	prep := func(q string) (*sql.Stmt, error) {
+		return p.db.PrepareContext(ctx, q)
+	}
+
+	var err error
+	if p.stmt.insert, err = prep(b.insert()); err != nil {
+		return err
+	}
+
+	if p.stmt.selectByID, err = prep(b.selectByID()); err != nil {
+		return err
+	}
+
+	if p.stmt.selectByUserKey, err = prep(b.selectByUserKey()); err != nil {
+		return err
+	}
+
+	if p.stmt.deleteByID, err = prep(b.deleteByID()); err != nil {
+		return err
+	}
+
+	if p.stmt.deleteByUserKey, err = prep(b.deleteByUserKey()); err != nil {
+		return err
+	}
+
+	if p.stmt.deleteByUserKeyExcept, err = prep(b.deleteByUserKeyExcept()); err != nil {
+		return err
+	}
+
+	if p.stmt.deleteExpiredBatch, err = prep(b.deleteExpiredBatch()); err != nil {
+		return err
+	}
+
+	if p.stmt.selectByMeta, err = prep(b.selectByMeta()); err != nil {
+		return err
+	}
+
+	if p.stmt.selectLiveIDs, err = prep(b.selectLiveIDs()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close stops the cleanup loop started by New, if any, and releases
+// the prepared statements held by p. The underlying *sql.DB is owned
+// by the caller of New and is left open.
+func (p *PgStore) Close() error {
+	if p.cancelCleanup != nil {
+		p.cancelCleanup()
+	}
+
+	for _, s := range []*sql.Stmt{
+		p.stmt.insert,
+		p.stmt.selectByID,
+		p.stmt.selectByUserKey,
+		p.stmt.deleteByID,
+		p.stmt.deleteByUserKey,
+		p.stmt.deleteByUserKeyExcept,
+		p.stmt.deleteExpiredBatch,
+		p.stmt.selectByMeta,
+		p.stmt.selectLiveIDs,
+	} {
+		if s == nil {
+			continue
+		}
+
+		if err := s.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
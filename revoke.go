@@ -0,0 +1,259 @@
+package pgstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// defaultRevocationChannel is the NOTIFY/LISTEN channel name used
+// when WithRevocationChannel isn't supplied but revocation is
+// otherwise enabled via WithRevocationDSN.
+const defaultRevocationChannel = "sessionup_revoke"
+
+// minReconnectInterval and maxReconnectInterval bound the exponential
+// backoff pq.Listener uses when its LISTEN connection drops.
+const (
+	minReconnectInterval = 10 * time.Second
+	maxReconnectInterval = time.Minute
+)
+
+// ErrRevocationNotConfigured is returned by Subscribe when it is
+// called without WithRevocationDSN having been set on New.
+var ErrRevocationNotConfigured = errors.New("pgstore: revocation not configured, see WithRevocationDSN")
+
+// RevocationEvent describes a session, or all of a user's sessions,
+// that has been revoked somewhere in the cluster.
+type RevocationEvent struct {
+	// ID is set when a single session was revoked via DeleteByID.
+	ID string
+
+	// UserKey is set when all of a user's sessions were revoked via
+	// DeleteByUserKey.
+	UserKey string
+
+	// ExceptIDs holds the session IDs deliberately kept alive when
+	// DeleteByUserKey was called with its expID variant ("log out
+	// everywhere except these sessions"). When set, subscribers must
+	// treat UserKey's revocation as applying to every session of
+	// UserKey except the ones listed here, rather than all of them.
+	ExceptIDs []string
+
+	// Resync is set on a dedicated event delivered after the
+	// underlying LISTEN connection reconnects; notifications received
+	// around the reconnect may be delivered before or after it, so
+	// it is not guaranteed to be the first event. Postgres does not
+	// persist NOTIFY payloads, so individual revocations raised
+	// during the outage can't be replayed; instead, Subscribe runs a
+	// reconciliation query and populates LiveIDs with every session
+	// ID still live at reconnect time, so callers can revoke any
+	// locally cached session that's missing from it.
+	Resync bool
+
+	// LiveIDs holds the full set of currently-live session IDs, as of
+	// the reconciliation query Subscribe ran after reconnecting. It
+	// is only set when Resync is true, and is nil if that query
+	// failed (callers should fall back to querying PgStore directly
+	// in that case).
+	LiveIDs []string
+}
+
+// WithRevocationChannel sets the Postgres NOTIFY/LISTEN channel name
+// used to broadcast session revocations across PgStore instances.
+// If not set, defaultRevocationChannel is used. It has no effect
+// unless WithRevocationDSN is also supplied.
+func WithRevocationChannel(name string) Option {
+	return func(p *PgStore) {
+		p.revokeChan = name
+	}
+}
+
+// WithRevocationDSN enables cross-node revocation notifications and
+// sets the connection string pq.Listener uses for its dedicated
+// LISTEN connection. This is required in addition to the *sql.DB
+// passed to New because database/sql pools connections internally
+// and does not expose the DSN it was opened with.
+func WithRevocationDSN(dsn string) Option {
+	return func(p *PgStore) {
+		p.revokeDSN = dsn
+	}
+}
+
+// revocationChannel returns the configured NOTIFY/LISTEN channel
+// name, falling back to defaultRevocationChannel.
+func (p *PgStore) revocationChannel() string {
+	if p.revokeChan == "" {
+		return defaultRevocationChannel
+	}
+
+	return p.revokeChan
+}
+
+// notifyRevoke sends a NOTIFY on the configured revocation channel.
+// It is a no-op if WithRevocationDSN hasn't been set.
+func (p *PgStore) notifyRevoke(ctx context.Context, payload string) error {
+	if p.revokeDSN == "" {
+		return nil
+	}
+
+	_, err := p.db.ExecContext(ctx, "SELECT pg_notify($1, $2);", p.revocationChannel(), payload)
+	return err
+}
+
+// Subscribe opens a dedicated LISTEN connection on the revocation
+// channel and returns a channel of RevocationEvent raised by
+// DeleteByID/DeleteByUserKey calls anywhere in the cluster (including
+// this instance). The listener reconnects using pq.Listener's own
+// exponential backoff, and right after each reconnect Subscribe runs
+// a reconciliation query and delivers a RevocationEvent with Resync
+// set and LiveIDs populated, so callers can revoke any locally cached
+// session missing from that snapshot instead of losing revocations
+// that happened during the outage. The returned channel is closed
+// once ctx is cancelled.
+func (p *PgStore) Subscribe(ctx context.Context) (<-chan RevocationEvent, error) {
+	if p.revokeDSN == "" {
+		return nil, ErrRevocationNotConfigured
+	}
+
+	resync := make(chan struct{}, 1)
+	l := pq.NewListener(p.revokeDSN, minReconnectInterval, maxReconnectInterval,
+		func(ev pq.ListenerEventType, err error) {
+			if ev == pq.ListenerEventReconnected {
+				select {
+				case resync <- struct{}{}:
+				default:
+				}
+			}
+		})
+
+	if err := l.Listen(p.revocationChannel()); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	events := make(chan RevocationEvent)
+
+	go func() {
+		defer l.Close()
+		defer close(events)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-resync:
+				// Best-effort: if the reconciliation query itself
+				// fails (e.g. the pool connection hasn't recovered
+				// yet either), still deliver Resync so callers know
+				// to fall back to querying PgStore directly, rather
+				// than dropping the notification entirely.
+				ids, _ := p.reconcileLiveIDs(ctx)
+
+				select {
+				case events <- RevocationEvent{Resync: true, LiveIDs: ids}:
+				case <-ctx.Done():
+					return
+				}
+			case n, ok := <-l.Notify:
+				if !ok {
+					return
+				}
+
+				if n == nil {
+					continue
+				}
+
+				select {
+				case events <- parseRevocationEvent(n.Extra):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// reconcileLiveIDs runs the reconciliation sweep backing Resync
+// events: it queries every session ID still live right now, so a
+// caller whose cache was built before the LISTEN connection dropped
+// can revoke anything not present in the result and recover the
+// revocations it missed during the outage.
+func (p *PgStore) reconcileLiveIDs(ctx context.Context) ([]string, error) {
+	rows, err := p.stmt.selectLiveIDs.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// parseRevocationEvent decodes a NOTIFY payload produced by
+// notifyRevoke. IDs are sessionup-generated opaque strings and
+// UserKeys are application-defined, so the payload is prefixed to
+// unambiguously tell the two apart.
+func parseRevocationEvent(payload string) RevocationEvent {
+	if id, ok := cutPrefix(payload, "id:"); ok {
+		return RevocationEvent{ID: id}
+	}
+
+	if rest, ok := cutPrefix(payload, "keyexcept:"); ok {
+		// The except IDs come first, comma-joined, followed by a
+		// colon and the key itself; unlike UserKey, IDs are
+		// sessionup-generated and never contain a comma or colon, so
+		// splitting on the first colon is unambiguous even if key
+		// does contain one.
+		csv, key, _ := cutAt(rest, ':')
+
+		var except []string
+		if csv != "" {
+			except = strings.Split(csv, ",")
+		}
+
+		return RevocationEvent{UserKey: key, ExceptIDs: except}
+	}
+
+	key, _ := cutPrefix(payload, "key:")
+	return RevocationEvent{UserKey: key}
+}
+
+// cutAt splits s at the first occurrence of sep, returning the parts
+// before and after it. If sep isn't present, before is s and found is
+// false.
+func cutAt(s string, sep byte) (before, after string, found bool) {
+	i := strings.IndexByte(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+
+	return s[:i], s[i+1:], true
+}
+
+// cutPrefix is a small strings.HasPrefix/TrimPrefix helper kept local
+// to avoid depending on the strings.Cut (Go 1.18+) API.
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+
+	return strings.TrimPrefix(s, prefix), true
+}
@@ -0,0 +1,100 @@
+package pgstore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRevocationChannel(t *testing.T) {
+	p := &PgStore{}
+	if got := p.revocationChannel(); got != defaultRevocationChannel {
+		t.Errorf("want %q, got %q", defaultRevocationChannel, got)
+	}
+
+	p.revokeChan = "custom_channel"
+	if got := p.revocationChannel(); got != "custom_channel" {
+		t.Errorf("want %q, got %q", "custom_channel", got)
+	}
+}
+
+func TestNotifyRevokeNoop(t *testing.T) {
+	p := &PgStore{}
+	if err := p.notifyRevoke(context.Background(), "id:foo"); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
+
+func TestSubscribeNotConfigured(t *testing.T) {
+	p := &PgStore{}
+	_, err := p.Subscribe(context.Background())
+	if err != ErrRevocationNotConfigured {
+		t.Errorf("want %v, got %v", ErrRevocationNotConfigured, err)
+	}
+}
+
+func TestParseRevocationEvent(t *testing.T) {
+	cc := map[string]struct {
+		Payload string
+		Want    RevocationEvent
+	}{
+		"ID payload":             {Payload: "id:abc", Want: RevocationEvent{ID: "abc"}},
+		"UserKey payload":        {Payload: "key:user1", Want: RevocationEvent{UserKey: "user1"}},
+		"UserKey except payload": {Payload: "keyexcept:id1,id2:user1", Want: RevocationEvent{UserKey: "user1", ExceptIDs: []string{"id1", "id2"}}},
+		"UserKey except payload, key contains a colon": {
+			Payload: "keyexcept:id1:user:1",
+			Want:    RevocationEvent{UserKey: "user:1", ExceptIDs: []string{"id1"}},
+		},
+	}
+
+	for cn, c := range cc {
+		t.Run(cn, func(t *testing.T) {
+			got := parseRevocationEvent(c.Payload)
+			if !reflect.DeepEqual(got, c.Want) {
+				t.Errorf("want %v, got %v", c.Want, got)
+			}
+		})
+	}
+}
+
+func TestReconcileLiveIDs(t *testing.T) {
+	db, mock := mockDB(t)
+	defer db.Close()
+	tName := "sessions"
+	q := fmt.Sprintf("SELECT id FROM %s WHERE expires_at > CURRENT_TIMESTAMP;", tName)
+	pg := PgStore{db: db, tName: tName, stmt: stmts{selectLiveIDs: prepareStmt(t, db, mock, q)}}
+
+	// 1
+	mock.ExpectQuery(q).WillReturnError(terr)
+	ids, err := pg.reconcileLiveIDs(context.Background())
+	if err != terr {
+		t.Errorf("want %v, got %v", terr, err)
+	}
+
+	if ids != nil {
+		t.Errorf("want nil, got %v", ids)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	// 2
+	rows := sqlmock.NewRows([]string{"id"}).AddRow("id1").AddRow("id2")
+	mock.ExpectQuery(q).WillReturnRows(rows)
+	ids, err = pg.reconcileLiveIDs(context.Background())
+	if err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+
+	if !reflect.DeepEqual(ids, []string{"id1", "id2"}) {
+		t.Errorf("want %v, got %v", []string{"id1", "id2"}, ids)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
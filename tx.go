@@ -0,0 +1,45 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+// stmtQuerier is satisfied by a *sql.Stmt and by the *sql.Stmt
+// returned from tx.StmtContext, letting fetchByID and fetchByUserKey
+// run a prepared statement against either the pool or a specific
+// transaction without duplicating their scanning logic.
+type stmtQuerier interface {
+	QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error)
+}
+
+// WithReadTxOptions makes FetchByID and FetchByUserKey run inside a
+// transaction opened with the given options, e.g.
+// &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+// for a consistent snapshot that Postgres also accepts on hot-standby
+// replicas. Without this option, fetches use the default fast path of
+// a single statement against the pool. Passing nil restores the
+// default fast path.
+func WithReadTxOptions(opts *sql.TxOptions) Option {
+	return func(p *PgStore) {
+		p.readTxOpts = opts
+	}
+}
+
+// finishReadTx commits tx when err is nil, otherwise it rolls tx
+// back. A rollback failure is only logged, not returned, since err
+// already describes what went wrong on the read path and a failed
+// rollback shouldn't mask it.
+func (p *PgStore) finishReadTx(tx *sql.Tx, err error) error {
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("pgstore: failed to roll back read-only transaction: %v", rbErr)
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/swithek/sessionup"
+)
+
+func TestFetchByIDReadTx(t *testing.T) {
+	db, mock := mockDB(t)
+	defer db.Close()
+
+	tName := "sessions"
+	opts := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	q := fmt.Sprintf("SELECT * FROM %s WHERE id = $1 AND expires_at > CURRENT_TIMESTAMP;", tName)
+	pg := PgStore{db: db, tName: tName, readTxOpts: opts, stmt: stmts{selectByID: prepareStmt(t, db, mock, q)}}
+
+	s := sessionup.Session{
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now(),
+		ID:        "id",
+		UserKey:   "key",
+		IP:        net.ParseIP("127.0.0.1"),
+	}
+
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"created_at", "expires_at", "id",
+		"user_key", "ip", "agent_os", "agent_browser", "meta_enc", "meta"}).
+		AddRow(s.CreatedAt, s.ExpiresAt, s.ID, s.UserKey, s.IP.String(), "", "", nil, []byte("{}"))
+	mock.ExpectQuery(q).WithArgs(s.ID).WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	got, ok, err := pg.FetchByID(context.Background(), s.ID)
+	if err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+
+	if !ok {
+		t.Fatal("want true, got false")
+	}
+
+	if got.ID != s.ID {
+		t.Errorf("want %q, got %q", s.ID, got.ID)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
+
+func TestFetchByIDReadTxRollbackOnError(t *testing.T) {
+	db, mock := mockDB(t)
+	defer db.Close()
+
+	tName := "sessions"
+	q := fmt.Sprintf("SELECT * FROM %s WHERE id = $1 AND expires_at > CURRENT_TIMESTAMP;", tName)
+	pg := PgStore{db: db, tName: tName, readTxOpts: &sql.TxOptions{ReadOnly: true},
+		stmt: stmts{selectByID: prepareStmt(t, db, mock, q)}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(q).WithArgs("id").WillReturnError(terr)
+	mock.ExpectRollback()
+
+	_, _, err := pg.FetchByID(context.Background(), "id")
+	if err != terr {
+		t.Errorf("want %v, got %v", terr, err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}